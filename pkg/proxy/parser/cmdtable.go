@@ -0,0 +1,517 @@
+// Copyright 2014 Wandoujia Inc. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// funGetKeys extracts the keys touched by a command whose key positions
+// can't be described by a fixed first/last/step, such as SORT ... STORE.
+type funGetKeys func(r *Resp) ([][]byte, error)
+
+// CommandSpec describes how to find the keys in a command, mirroring the
+// shape Redis itself reports via COMMAND INFO: a first key position, a
+// last key position (LastKey == -1 means "the last argument", for
+// variadic commands like MSET), and the step between repeated keys. For
+// commands whose key positions move depending on other arguments,
+// MovableKeys is set and Extractor is used instead.
+type CommandSpec struct {
+	FirstKey int
+	LastKey  int
+	KeyStep  int
+
+	MovableKeys bool
+	Extractor   funGetKeys
+}
+
+// commandTableMu guards commandTable: RegisterCommand can run concurrently
+// with Keys() looking up commands on other connections' goroutines.
+var commandTableMu sync.RWMutex
+var commandTable = make(map[string]CommandSpec, len(builtinCommandTable))
+
+func init() {
+	for name, spec := range builtinCommandTable {
+		commandTable[name] = spec
+	}
+}
+
+// RegisterCommand teaches the proxy how to find the keys in a command by
+// name, so operators can route module commands the proxy doesn't ship
+// with. It overwrites any existing entry for the same name. Safe to call
+// concurrently with Keys().
+func RegisterCommand(name string, spec CommandSpec) {
+	commandTableMu.Lock()
+	commandTable[strings.ToUpper(name)] = spec
+	commandTableMu.Unlock()
+}
+
+func lookupCommand(name string) (CommandSpec, bool) {
+	commandTableMu.RLock()
+	spec, ok := commandTable[name]
+	commandTableMu.RUnlock()
+	return spec, ok
+}
+
+var builtinCommandTable = map[string]CommandSpec{
+	// no keys
+	"PING":       {},
+	"SLOTSNUM":   {},
+	"SLOTSCHECK": {},
+
+	// single key: strings, bitmaps, generic key commands
+	"GET": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "SET": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SETNX": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "SETEX": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"PSETEX": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "APPEND": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"STRLEN": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "GETSET": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"GETDEL": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "GETEX": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"GETRANGE": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "SETRANGE": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"INCR": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "DECR": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"INCRBY": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "DECRBY": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"INCRBYFLOAT": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SETBIT":      {FirstKey: 1, LastKey: 1, KeyStep: 1}, "GETBIT": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"BITCOUNT": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "BITPOS": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"BITFIELD": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "BITFIELD_RO": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"TYPE": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "DUMP": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"RESTORE": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"TTL":     {FirstKey: 1, LastKey: 1, KeyStep: 1}, "PTTL": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"PERSIST": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"EXPIRE":  {FirstKey: 1, LastKey: 1, KeyStep: 1}, "PEXPIRE": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"EXPIREAT": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "PEXPIREAT": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"EXPIRETIME": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "PEXPIRETIME": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+
+	// single key: hashes
+	"HSET": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "HSETNX": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HGET": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "HMSET": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HMGET": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "HDEL": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HEXISTS": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "HINCRBY": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HINCRBYFLOAT": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HKEYS":        {FirstKey: 1, LastKey: 1, KeyStep: 1}, "HVALS": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HGETALL": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "HLEN": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HSTRLEN": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "HSCAN": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HRANDFIELD": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+
+	// single key: lists
+	"LPUSH": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "RPUSH": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LPUSHX": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "RPUSHX": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LPOP": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "RPOP": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LLEN": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "LRANGE": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LINDEX": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "LSET": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LREM": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "LTRIM": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LINSERT": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "LPOS": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+
+	// two keys: list/key moves, where the trailing arguments (if any)
+	// are never keys, so a fixed LastKey of 2 already ignores them
+	"RENAME": {FirstKey: 1, LastKey: 2, KeyStep: 1}, "RENAMENX": {FirstKey: 1, LastKey: 2, KeyStep: 1},
+	"COPY": {FirstKey: 1, LastKey: 2, KeyStep: 1}, "SMOVE": {FirstKey: 1, LastKey: 2, KeyStep: 1},
+	"LMOVE": {FirstKey: 1, LastKey: 2, KeyStep: 1}, "RPOPLPUSH": {FirstKey: 1, LastKey: 2, KeyStep: 1},
+	"BLMOVE": {FirstKey: 1, LastKey: 2, KeyStep: 1}, "BRPOPLPUSH": {FirstKey: 1, LastKey: 2, KeyStep: 1},
+
+	// single key: sets
+	"SADD": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "SREM": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SISMEMBER": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "SMISMEMBER": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SCARD": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "SMEMBERS": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SPOP": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "SRANDMEMBER": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SSCAN": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+
+	// variadic sets, all keys
+	"SINTER": {FirstKey: 1, LastKey: -1, KeyStep: 1}, "SUNION": {FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"SDIFF": {FirstKey: 1, LastKey: -1, KeyStep: 1},
+	// variadic sets, first key is the destination
+	"SINTERSTORE": {FirstKey: 1, LastKey: -1, KeyStep: 1}, "SUNIONSTORE": {FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"SDIFFSTORE": {FirstKey: 1, LastKey: -1, KeyStep: 1},
+
+	// single key: sorted sets
+	"ZADD": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZREM": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZSCORE": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZMSCORE": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZINCRBY": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZCARD": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZCOUNT": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZLEXCOUNT": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZRANGE": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZREVRANGE": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZRANGEBYSCORE": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZREVRANGEBYSCORE": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZRANGEBYLEX": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZREVRANGEBYLEX": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZRANK": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZREVRANK": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZREMRANGEBYRANK": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZREMRANGEBYSCORE": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZREMRANGEBYLEX": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZSCAN": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZPOPMIN": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "ZPOPMAX": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+
+	// blocking variadic-key commands: every argument but the trailing
+	// timeout is a key
+	"BLPOP": {MovableKeys: true, Extractor: blockingKeys}, "BRPOP": {MovableKeys: true, Extractor: blockingKeys},
+	"BZPOPMIN": {MovableKeys: true, Extractor: blockingKeys}, "BZPOPMAX": {MovableKeys: true, Extractor: blockingKeys},
+
+	// single key: geo, streams, hyperloglog
+	"GEOADD": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "GEOPOS": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"GEODIST": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "GEOHASH": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"GEOSEARCH": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "GEOSEARCHSTORE": {FirstKey: 1, LastKey: 2, KeyStep: 1},
+	"XADD": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "XLEN": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XRANGE": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "XREVRANGE": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XTRIM": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "XDEL": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XACK": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "XCLAIM": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XAUTOCLAIM": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "XGROUP": {FirstKey: 2, LastKey: 2, KeyStep: 1},
+	"XPENDING": {FirstKey: 1, LastKey: 1, KeyStep: 1}, "XSETID": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"PFADD": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+
+	// variadic, one key per argument
+	"MGET":    {FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"DEL":     {FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"UNLINK":  {FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"EXISTS":  {FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"TOUCH":   {FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"WATCH":   {FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"PFCOUNT": {FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"PFMERGE": {FirstKey: 1, LastKey: -1, KeyStep: 1},
+
+	// variadic, key/value pairs
+	"MSET":   {FirstKey: 1, LastKey: -1, KeyStep: 2},
+	"MSETNX": {FirstKey: 1, LastKey: -1, KeyStep: 2},
+
+	// destination key, then variadic source keys
+	"BITOP": {FirstKey: 2, LastKey: -1, KeyStep: 1},
+
+	// movable keys
+	"OBJECT":       {MovableKeys: true, Extractor: secondArgKey},
+	"MEMORY":       {MovableKeys: true, Extractor: memoryUsageKey},
+	"EVAL":         {MovableKeys: true, Extractor: numkeysThirdArgKeys},
+	"EVALSHA":      {MovableKeys: true, Extractor: numkeysThirdArgKeys},
+	"ZUNIONSTORE":  {MovableKeys: true, Extractor: numkeysThirdArgKeys},
+	"ZINTERSTORE":  {MovableKeys: true, Extractor: numkeysThirdArgKeys},
+	"SORT":         {MovableKeys: true, Extractor: sortKeys},
+	"SORT_RO":      {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"GEORADIUS":    {MovableKeys: true, Extractor: georadiusKeys},
+	"GEORADIUS_RO": {FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"MIGRATE":      {MovableKeys: true, Extractor: migrateKeys},
+	"XREAD":        {MovableKeys: true, Extractor: xreadKeys},
+	"XREADGROUP":   {MovableKeys: true, Extractor: xreadKeys},
+}
+
+// Keys returns the keys a command touches, consulting the command table
+// keyed by the command's Op(). Commands absent from the table fall back
+// to treating every argument as a key, which is the conservative default
+// codis used before the table existed.
+func (r *Resp) Keys() ([][]byte, error) {
+	op, err := r.Op()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	spec, ok := lookupCommand(strings.ToUpper(string(op)))
+	if !ok {
+		return defaultGetKeys(r)
+	}
+
+	if spec.MovableKeys {
+		return spec.Extractor(r)
+	}
+
+	return fixedKeys(r, spec)
+}
+
+func fixedKeys(r *Resp, spec CommandSpec) ([][]byte, error) {
+	if spec.FirstKey == 0 || spec.FirstKey >= len(r.Multi) {
+		return nil, nil
+	}
+
+	last := spec.LastKey
+	if last < 0 {
+		last = len(r.Multi) - 1
+	}
+
+	var keys [][]byte
+	for i := spec.FirstKey; i <= last && i < len(r.Multi); i += spec.KeyStep {
+		key, err := bulkValue(r.Multi[i])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func defaultGetKeys(r *Resp) ([][]byte, error) {
+	count := len(r.Multi[1:])
+	if count == 0 {
+		return nil, nil
+	}
+
+	keys := make([][]byte, 0, count)
+	for _, v := range r.Multi[1:] {
+		key, err := bulkValue(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// bulkValue strips the "$len\r\n" header off a parsed bulk Resp, returning
+// just the argument bytes.
+func bulkValue(v *Resp) ([]byte, error) {
+	raw := raw2Bulk(v)
+	pos := bytes.IndexByte(raw, '\n')
+	if pos < 0 {
+		return nil, errors.Errorf("invalid resp %+v", v)
+	}
+
+	return raw[pos+1:], nil
+}
+
+func numkeysThirdArgKeys(r *Resp) ([][]byte, error) {
+	if len(r.Multi) < 4 { // e.g. EVAL script 0
+		return [][]byte{[]byte("fakeKey")}, nil
+	}
+
+	numArg, err := bulkValue(r.Multi[2])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	numKeys, err := Btoi(numArg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var keys [][]byte
+	for _, v := range r.Multi[3:] {
+		key, err := bulkValue(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		keys = append(keys, key)
+		if len(keys) == numKeys {
+			break
+		}
+	}
+
+	return keys, nil
+}
+
+// blockingKeys handles BLPOP/BRPOP/BZPOPMIN/BZPOPMAX key [key ...]
+// timeout: every argument is a key except the trailing timeout.
+func blockingKeys(r *Resp) ([][]byte, error) {
+	if len(r.Multi) < 3 {
+		return nil, errors.Errorf("invalid resp %+v", r)
+	}
+
+	var keys [][]byte
+	for _, v := range r.Multi[1 : len(r.Multi)-1] {
+		key, err := bulkValue(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// sortKeys handles SORT key [... STORE dest ...], which also touches dest
+// when present.
+func sortKeys(r *Resp) ([][]byte, error) {
+	if len(r.Multi) < 2 {
+		return nil, errors.Errorf("invalid resp %+v", r)
+	}
+
+	key, err := bulkValue(r.Multi[1])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	keys := [][]byte{key}
+
+	for i := 2; i < len(r.Multi)-1; i++ {
+		tok, err := bulkValue(r.Multi[i])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if strings.EqualFold(string(tok), "STORE") {
+			dest, err := bulkValue(r.Multi[i+1])
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			keys = append(keys, dest)
+			break
+		}
+	}
+
+	return keys, nil
+}
+
+// georadiusKeys handles GEORADIUS's optional STORE/STOREDIST destination
+// key. GEORADIUS_RO takes no destination and uses a fixed single-key spec.
+func georadiusKeys(r *Resp) ([][]byte, error) {
+	if len(r.Multi) < 2 {
+		return nil, errors.Errorf("invalid resp %+v", r)
+	}
+
+	key, err := bulkValue(r.Multi[1])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	keys := [][]byte{key}
+
+	for i := 2; i < len(r.Multi)-1; i++ {
+		tok, err := bulkValue(r.Multi[i])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		switch strings.ToUpper(string(tok)) {
+		case "STORE", "STOREDIST":
+			dest, err := bulkValue(r.Multi[i+1])
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			keys = append(keys, dest)
+		}
+	}
+
+	return keys, nil
+}
+
+// migrateKeys handles MIGRATE's single-key form (the third argument,
+// unless empty) and its multi-key KEYS k1 [k2 ...] form.
+func migrateKeys(r *Resp) ([][]byte, error) {
+	if len(r.Multi) < 4 {
+		return nil, errors.Errorf("invalid resp %+v", r)
+	}
+
+	key, err := bulkValue(r.Multi[3])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(key) > 0 {
+		// the positional form: MIGRATE host port key dest-db timeout ...
+		return [][]byte{key}, nil
+	}
+
+	// key is empty, which per MIGRATE's own wire format means the KEYS
+	// k1 [k2 ...] multi-key form was used instead; find that token.
+	for i := 4; i < len(r.Multi); i++ {
+		tok, err := bulkValue(r.Multi[i])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if strings.EqualFold(string(tok), "KEYS") {
+			var keys [][]byte
+			for _, kv := range r.Multi[i+1:] {
+				key, err := bulkValue(kv)
+				if err != nil {
+					return nil, errors.Trace(err)
+				}
+				keys = append(keys, key)
+			}
+			return keys, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// xreadKeys handles XREAD/XREADGROUP's STREAMS token: everything after it
+// is keys for the first half, IDs for the second.
+func xreadKeys(r *Resp) ([][]byte, error) {
+	for i, v := range r.Multi {
+		tok, err := bulkValue(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if !strings.EqualFold(string(tok), "STREAMS") {
+			continue
+		}
+
+		rest := r.Multi[i+1:]
+		if len(rest) == 0 || len(rest)%2 != 0 {
+			return nil, errors.Errorf("invalid resp %+v", r)
+		}
+
+		n := len(rest) / 2
+		keys := make([][]byte, 0, n)
+		for _, kv := range rest[:n] {
+			key, err := bulkValue(kv)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			keys = append(keys, key)
+		}
+
+		return keys, nil
+	}
+
+	return nil, errors.Errorf("invalid resp %+v, missing STREAMS", r)
+}
+
+// secondArgKey handles OBJECT <subcommand> key.
+func secondArgKey(r *Resp) ([][]byte, error) {
+	if len(r.Multi) < 3 {
+		return nil, nil
+	}
+
+	key, err := bulkValue(r.Multi[2])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return [][]byte{key}, nil
+}
+
+// memoryUsageKey handles MEMORY USAGE key; other MEMORY subcommands have
+// no key.
+func memoryUsageKey(r *Resp) ([][]byte, error) {
+	if len(r.Multi) < 2 {
+		return nil, nil
+	}
+
+	sub, err := bulkValue(r.Multi[1])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !strings.EqualFold(string(sub), "USAGE") {
+		return nil, nil
+	}
+
+	return secondArgKey(r)
+}
+
+// ErrCrossSlot is the error a caller should surface when SameSlot rejects
+// a multi-key command, matching Redis Cluster's own CROSSSLOT error.
+var ErrCrossSlot = errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+
+// SameSlot reports whether every key in keys hashes the same bytes, and so
+// lands in the same slot, honoring the {hashtag} convention: when a key
+// contains a non-empty {...} substring, only that substring is hashed.
+// Keys are compared by those hashed bytes, not by slot number, so keys
+// whose hashed bytes differ are reported as not sharing a slot even when
+// they happen to map to the same one.
+func SameSlot(keys [][]byte) bool {
+	if len(keys) < 2 {
+		return true
+	}
+
+	tag := hashTag(keys[0])
+	for _, key := range keys[1:] {
+		if !bytes.Equal(tag, hashTag(key)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hashTag(key []byte) []byte {
+	start := bytes.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+
+	end := bytes.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+
+	return key[start+1 : start+1+end]
+}
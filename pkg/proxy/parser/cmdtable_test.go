@@ -0,0 +1,166 @@
+// Copyright 2014 Wandoujia Inc. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func buildCmd(t *testing.T, args ...string) *Resp {
+	t.Helper()
+
+	var raw [][]byte
+	for _, a := range args {
+		raw = append(raw, []byte(a))
+	}
+	packet := AppendCommand(nil, raw...)
+
+	r, err := Parse(bufio.NewReader(bytes.NewReader(packet)))
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", args, err)
+	}
+	return r
+}
+
+func keysOf(t *testing.T, r *Resp) []string {
+	t.Helper()
+
+	keys, err := r.Keys()
+	if err != nil {
+		t.Fatalf("Keys(): %v", err)
+	}
+
+	var got []string
+	for _, k := range keys {
+		got = append(got, string(k))
+	}
+	return got
+}
+
+func TestKeysFixedAndVariadic(t *testing.T) {
+	cases := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"GET", "foo"}, []string{"foo"}},
+		{[]string{"SET", "foo", "bar"}, []string{"foo"}},
+		{[]string{"MSET", "a", "1", "b", "2"}, []string{"a", "b"}},
+		{[]string{"DEL", "a", "b", "c"}, []string{"a", "b", "c"}},
+		{[]string{"RENAME", "a", "b"}, []string{"a", "b"}},
+		{[]string{"BITOP", "AND", "dest", "a", "b"}, []string{"dest", "a", "b"}},
+		{[]string{"PING"}, nil},
+	}
+
+	for _, c := range cases {
+		got := keysOf(t, buildCmd(t, c.args...))
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Keys(%v) = %v, want %v", c.args, got, c.want)
+		}
+	}
+}
+
+func TestKeysBlocking(t *testing.T) {
+	got := keysOf(t, buildCmd(t, "BLPOP", "a", "b", "0"))
+	want := []string{"a", "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys(BLPOP a b 0) = %v, want %v", got, want)
+	}
+}
+
+func TestKeysSortAndGeoradiusStore(t *testing.T) {
+	got := keysOf(t, buildCmd(t, "SORT", "mylist", "STORE", "dest"))
+	want := []string{"mylist", "dest"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys(SORT ... STORE dest) = %v, want %v", got, want)
+	}
+
+	got = keysOf(t, buildCmd(t, "GEORADIUS", "geo", "0", "0", "1", "km", "STOREDIST", "dest"))
+	want = []string{"geo", "dest"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys(GEORADIUS ... STOREDIST dest) = %v, want %v", got, want)
+	}
+}
+
+func TestKeysMigratePositionalKeyNamedKEYS(t *testing.T) {
+	// A literal key named "KEYS" used in MIGRATE's ordinary positional
+	// form must not be mistaken for the multi-key KEYS token.
+	got := keysOf(t, buildCmd(t, "MIGRATE", "host", "6379", "KEYS", "0", "1000"))
+	want := []string{"KEYS"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys(MIGRATE ... KEYS 0 1000) = %v, want %v", got, want)
+	}
+}
+
+func TestKeysMigrateMultiKeyForm(t *testing.T) {
+	got := keysOf(t, buildCmd(t, "MIGRATE", "host", "6379", "", "0", "1000", "KEYS", "k1", "k2"))
+	want := []string{"k1", "k2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys(MIGRATE ... KEYS k1 k2) = %v, want %v", got, want)
+	}
+}
+
+func TestKeysUnregisteredCommandFallsBackToDefault(t *testing.T) {
+	got := keysOf(t, buildCmd(t, "NOTACOMMAND", "foo", "bar"))
+	want := []string{"foo", "bar"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys(NOTACOMMAND foo bar) = %v, want %v", got, want)
+	}
+}
+
+func TestSameSlot(t *testing.T) {
+	cases := []struct {
+		keys []string
+		want bool
+	}{
+		{nil, true},
+		{[]string{"a"}, true},
+		{[]string{"a", "b"}, false},
+		{[]string{"{user1}.a", "{user1}.b"}, true},
+		{[]string{"{user1}.a", "{user2}.b"}, false},
+		{[]string{"a", "a"}, true},
+	}
+
+	for _, c := range cases {
+		var keys [][]byte
+		for _, k := range c.keys {
+			keys = append(keys, []byte(k))
+		}
+		if got := SameSlot(keys); got != c.want {
+			t.Errorf("SameSlot(%v) = %v, want %v", c.keys, got, c.want)
+		}
+	}
+}
+
+// TestRegisterCommandConcurrentWithKeys exercises RegisterCommand's
+// documented "safe to call concurrently with Keys()" contract: a module
+// command registered on one goroutine while other goroutines are parsing
+// and keying commands must not race the commandTable map. Run with
+// -race to catch a regression.
+func TestRegisterCommandConcurrentWithKeys(t *testing.T) {
+	const n = 50
+
+	var wg sync.WaitGroup
+	wg.Add(2 * n)
+
+	cmd := buildCmd(t, "GET", "foo")
+
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			RegisterCommand("MODULE.CMD", CommandSpec{FirstKey: 1, LastKey: 1, KeyStep: 1})
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := cmd.Keys(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
@@ -30,30 +30,34 @@ const (
 	BulkResp
 	MultiResp
 	NoKey
+
+	// RESP3 types, see https://redis.io/topics/protocol
+	NullResp
+	BooleanResp
+	DoubleResp
+	BigNumberResp
+	VerbatimResp
+	BlobErrorResp
+	MapResp
+	SetResp
+	AttributeResp
+	PushResp
 )
 
 type Resp struct {
 	Type  int
 	Raw   []byte
 	Multi []*Resp
-}
 
-var (
-	noKeyOps = map[string]string{
-		"PING":       "fakeKey",
-		"SLOTSNUM":   "fakeKey",
-		"SLOTSCHECK": "fakeKey",
-	}
+	// Attr holds the attribute frame (RESP3 '|') that preceded this Resp on
+	// the wire, if any. It is metadata about the reply, not part of it, so
+	// Keys()/Op() never look inside it.
+	Attr *Resp
+}
 
-	keyFun    = make(map[string]funGetKeys)
-	intBuffer [][]byte
-)
+var intBuffer [][]byte
 
 func init() {
-	for _, v := range thridAsKeyTbl {
-		keyFun[v] = thridAsKey
-	}
-
 	cnt := 10000
 	intBuffer = make([][]byte, cnt)
 	for i := 0; i < cnt; i++ {
@@ -73,6 +77,18 @@ func Itoa(i int) []byte {
 	return []byte(strconv.Itoa(i))
 }
 
+// AppendInt appends the decimal form of n to dst and returns the extended
+// slice. Unlike Itoa, it never allocates an intermediate string: values
+// within the intBuffer cache are copied directly, and anything outside it
+// (including negatives) goes through strconv.AppendInt straight into dst.
+func AppendInt(dst []byte, n int64) []byte {
+	if n >= 0 && n < int64(len(intBuffer)) {
+		return append(dst, intBuffer[n]...)
+	}
+
+	return strconv.AppendInt(dst, n, 10)
+}
+
 //todo: overflow
 func Btoi(b []byte) (int, error) {
 	n := 0
@@ -121,8 +137,8 @@ func raw2Error(r *Resp) []byte {
 }
 
 func (r *Resp) Op() ([]byte, error) {
-	if len(r.Multi) > 0 {
-		op := raw2Bulk(r.Multi[0])
+	for _, v := range r.Multi {
+		op := raw2Bulk(v)
 		startPos := bytes.IndexByte(op, '\n')
 		if startPos < 0 {
 			return nil, errors.Errorf("invalid resp %+v", r)
@@ -134,27 +150,6 @@ func (r *Resp) Op() ([]byte, error) {
 	return nil, errors.Errorf("invalid resp %+v", r)
 }
 
-type funGetKeys func(r *Resp) ([][]byte, error)
-
-func defaultGetKeys(r *Resp) ([][]byte, error) {
-	count := len(r.Multi[1:])
-	if count == 0 {
-		return nil, nil
-	}
-
-	keys := make([][]byte, 0, count)
-	for _, v := range r.Multi[1:] {
-		key := raw2Bulk(v)
-		startPos := bytes.IndexByte(key, '\n')
-		if startPos < 0 {
-			return nil, errors.Errorf("invalid resp %+v", r)
-		}
-		keys = append(keys, key[startPos+1:])
-	}
-
-	return keys, nil
-}
-
 func Parse(r *bufio.Reader) (*Resp, error) {
 	line, err := readLine(r)
 	if err != nil {
@@ -202,6 +197,9 @@ func Parse(r *bufio.Reader) (*Resp, error) {
 			resp.Multi = multi
 		}
 		return resp, nil
+	case nullByte, booleanByte, doubleByte, bigNumberByte, verbatimByte,
+		blobErrorByte, mapByte, setByte, attributeByte, pushByte:
+		return parseResp3(r, line)
 	default:
 		if !IsLetter(line[0]) { //handle telnet text command
 			return nil, errors.New("redis protocol error, " + string(line))
@@ -268,43 +266,6 @@ func ReadBulk(r *bufio.Reader, size int, raw *[]byte) error {
 	return nil
 }
 
-var thridAsKeyTbl = []string{"ZINTERSTORE", "ZUNIONSTORE", "EVAL", "EVALSHA"}
-
-func thridAsKey(r *Resp) ([][]byte, error) {
-	if len(r.Multi) < 4 { //if EVAL with no key
-		return [][]byte{[]byte("fakeKey")}, nil
-	}
-
-	numKeys, err := Btoi(raw2Bulk(r.Multi[2]))
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-
-	var keys [][]byte
-	for _, v := range r.Multi[3:] {
-		keys = append(keys, raw2Bulk(v))
-		if len(keys) == numKeys {
-			break
-		}
-	}
-
-	return keys, nil
-}
-
-func (r *Resp) Keys() ([][]byte, error) {
-	key, err := r.Op()
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-
-	f, ok := keyFun[string(key)]
-	if !ok {
-		return defaultGetKeys(r)
-	}
-
-	return f(r)
-}
-
 func (r *Resp) Key() ([]byte, error) {
 	keys, err := r.Keys()
 	if len(keys) > 0 {
@@ -332,30 +293,38 @@ func (r *Resp) getIntegerBuf() []byte {
 
 func (r *Resp) Bytes() ([]byte, error) {
 	var buf []byte
+
+	if r.Attr != nil {
+		attrBuf, err := r.Attr.Bytes()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		buf = append(buf, attrBuf...)
+	}
+
 	switch r.Type {
 	case NoKey:
 		buf = append(buf, raw2Bulk(r)...)
 		buf = append(buf, NEW_LINE...)
 	case SimpleString:
-		buf = r.getSimpleStringBuf()
+		buf = append(buf, r.getSimpleStringBuf()...)
 	case ErrorResp:
-		buf = r.getErrorBuf()
+		buf = append(buf, r.getErrorBuf()...)
 	case IntegerResp:
-		buf = r.getIntegerBuf()
-	case BulkResp:
-		buf = r.getBulkBuf()
-	case MultiResp:
-		buf = make([]byte, 0, 256)
+		buf = append(buf, r.getIntegerBuf()...)
+	case BulkResp, VerbatimResp, BlobErrorResp:
+		buf = append(buf, r.getBulkBuf()...)
+	case NullResp, BooleanResp, DoubleResp, BigNumberResp:
+		buf = append(buf, r.Raw...)
+	case MultiResp, MapResp, SetResp, AttributeResp, PushResp:
 		buf = append(buf, r.Raw...)
 
-		if len(r.Multi) > 0 {
-			for _, resp := range r.Multi {
-				slice, err := resp.Bytes()
-				if err != nil {
-					return nil, errors.Trace(err)
-				}
-				buf = append(buf, slice...)
+		for _, resp := range r.Multi {
+			slice, err := resp.Bytes()
+			if err != nil {
+				return nil, errors.Trace(err)
 			}
+			buf = append(buf, slice...)
 		}
 	}
 
@@ -0,0 +1,234 @@
+// Copyright 2014 Wandoujia Inc. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package parser
+
+import (
+	"bufio"
+	"strconv"
+
+	"github.com/juju/errors"
+)
+
+// RESP3 type prefixes, see https://redis.io/topics/protocol
+const (
+	nullByte      = '_'
+	booleanByte   = '#'
+	doubleByte    = ','
+	bigNumberByte = '('
+	verbatimByte  = '='
+	blobErrorByte = '!'
+	mapByte       = '%'
+	setByte       = '~'
+	attributeByte = '|'
+	pushByte      = '>'
+)
+
+// parseResp3 decodes the RESP3 types that don't fit the RESP2 switch in
+// Parse. line is the already-read header line, including its leading type
+// byte and trailing \r\n.
+func parseResp3(r *bufio.Reader, line []byte) (*Resp, error) {
+	resp := &Resp{Raw: line}
+
+	switch line[0] {
+	case nullByte:
+		resp.Type = NullResp
+		return resp, nil
+	case booleanByte:
+		resp.Type = BooleanResp
+		return resp, nil
+	case doubleByte:
+		resp.Type = DoubleResp
+		return resp, nil
+	case bigNumberByte:
+		resp.Type = BigNumberResp
+		return resp, nil
+	case verbatimByte:
+		resp.Type = VerbatimResp
+		size, err := Btoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err := ReadBulk(r, size, &resp.Raw); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return resp, nil
+	case blobErrorByte:
+		resp.Type = BlobErrorResp
+		size, err := Btoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err := ReadBulk(r, size, &resp.Raw); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return resp, nil
+	case mapByte:
+		n, err := Btoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		resp.Type = MapResp
+		if resp.Multi, err = parseMulti(r, 2*n); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return resp, nil
+	case setByte:
+		n, err := Btoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		resp.Type = SetResp
+		if resp.Multi, err = parseMulti(r, n); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return resp, nil
+	case pushByte:
+		n, err := Btoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		resp.Type = PushResp
+		if resp.Multi, err = parseMulti(r, n); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return resp, nil
+	case attributeByte:
+		n, err := Btoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		attr := &Resp{Type: AttributeResp, Raw: line}
+		if attr.Multi, err = parseMulti(r, 2*n); err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		// An attribute frame always precedes the reply it annotates, so
+		// fold it into that reply rather than handing it to the caller as
+		// a standalone value: Keys()/Op() never need to know it was there.
+		real, err := Parse(r)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		real.Attr = attr
+		return real, nil
+	}
+
+	return nil, errors.Errorf("redis protocol error, unknown resp3 type %q", line[0])
+}
+
+func parseMulti(r *bufio.Reader, n int) ([]*Resp, error) {
+	if n < 0 {
+		return nil, nil
+	}
+
+	multi := make([]*Resp, n)
+	for i := 0; i < n; i++ {
+		rp, err := Parse(r)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		multi[i] = rp
+	}
+
+	return multi, nil
+}
+
+// ProtocolVersion identifies the RESP wire protocol a client negotiated via
+// the HELLO command.
+type ProtocolVersion int
+
+const (
+	RESP2 ProtocolVersion = 2
+	RESP3 ProtocolVersion = 3
+)
+
+// HandleHello parses the arguments of a HELLO command, as returned by
+// Resp.Keys()-style access to the command's Multi slice (args excludes the
+// "HELLO" token itself), and reports the protocol version the client is
+// requesting. HELLO with no arguments keeps the connection's current
+// version, which this reports as RESP2 per Redis' default.
+func HandleHello(args [][]byte) (ProtocolVersion, error) {
+	if len(args) == 0 {
+		return RESP2, nil
+	}
+
+	ver, err := Btoi(args[0])
+	if err != nil {
+		return 0, errors.Errorf("NOPROTO unsupported protocol version")
+	}
+
+	switch ver {
+	case 2:
+		return RESP2, nil
+	case 3:
+		return RESP3, nil
+	default:
+		return 0, errors.Errorf("NOPROTO unsupported protocol version")
+	}
+}
+
+// Downgrade rewrites r in place into the RESP2 equivalent of a RESP3 reply,
+// for backends that were never told about HELLO 3: maps become flat
+// arrays, sets become arrays, booleans become :0/:1, doubles and verbatim
+// strings become bulk strings, big numbers become simple strings, blob
+// errors become simple errors, and null becomes $-1. Any attribute frame
+// attached to r or to an element nested inside it is dropped. Apart from
+// that, replies that are already RESP2 types, with no RESP3 types nested
+// inside them, are left untouched.
+func (r *Resp) Downgrade() {
+	switch r.Type {
+	case NullResp:
+		r.Type = BulkResp
+		r.Raw = []byte("$-1\r\n")
+	case BooleanResp:
+		r.Type = IntegerResp
+		if len(r.Raw) > 1 && r.Raw[1] == 't' {
+			r.Raw = []byte(":1\r\n")
+		} else {
+			r.Raw = []byte(":0\r\n")
+		}
+	case DoubleResp:
+		r.Type = BulkResp
+		r.Raw = bulkFrom(r.Raw[1 : len(r.Raw)-2])
+	case BigNumberResp:
+		r.Type = SimpleString
+		r.Raw = append([]byte{'+'}, r.Raw[1:]...)
+	case VerbatimResp:
+		body, err := scalarBulk(r)
+		if err == nil {
+			if len(body) > 4 && body[3] == ':' {
+				body = body[4:]
+			}
+			r.Type = BulkResp
+			r.Raw = bulkFrom(body)
+		}
+	case BlobErrorResp:
+		body, err := scalarBulk(r)
+		if err == nil {
+			r.Type = ErrorResp
+			r.Raw = append([]byte{'-'}, body...)
+			r.Raw = append(r.Raw, NEW_LINE...)
+		}
+	case MapResp, SetResp, PushResp:
+		r.Type = MultiResp
+		r.Raw = append([]byte{'*'}, Itoa(len(r.Multi))...)
+		r.Raw = append(r.Raw, NEW_LINE...)
+	}
+
+	for _, sub := range r.Multi {
+		sub.Downgrade()
+	}
+	r.Attr = nil
+}
+
+func bulkFrom(body []byte) []byte {
+	raw := make([]byte, 0, len(body)+16)
+	raw = append(raw, '$')
+	raw = append(raw, []byte(strconv.Itoa(len(body)))...)
+	raw = append(raw, NEW_LINE...)
+	raw = append(raw, body...)
+	raw = append(raw, NEW_LINE...)
+	return raw
+}
@@ -0,0 +1,110 @@
+// Copyright 2014 Wandoujia Inc. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, s string) *Resp {
+	t.Helper()
+	r, err := Parse(bufio.NewReader(strings.NewReader(s)))
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", s, err)
+	}
+	return r
+}
+
+func TestResp3BytesRoundTrip(t *testing.T) {
+	cases := []string{
+		"_\r\n",
+		"#t\r\n",
+		"#f\r\n",
+		",3.14159\r\n",
+		"(3492890328409238509324850943850943825024385\r\n",
+		"=15\r\ntxt:Some string\r\n",
+		"!21\r\nSYNTAX invalid syntax\r\n",
+		"%2\r\n$3\r\nfoo\r\n:1\r\n$3\r\nbar\r\n:2\r\n",
+		"~2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n",
+		">2\r\n$7\r\nmessage\r\n$3\r\nfoo\r\n",
+		"|1\r\n$8\r\nttl-info\r\n:100\r\n$3\r\nfoo\r\n",
+	}
+
+	for _, c := range cases {
+		r := mustParse(t, c)
+		got, err := r.Bytes()
+		if err != nil {
+			t.Fatalf("Bytes(%q): %v", c, err)
+		}
+		if !bytes.Equal(got, []byte(c)) {
+			t.Errorf("round-trip %q: got %q", c, got)
+		}
+	}
+}
+
+func TestHandleHello(t *testing.T) {
+	cases := []struct {
+		args []string
+		want ProtocolVersion
+		err  bool
+	}{
+		{nil, RESP2, false},
+		{[]string{"2"}, RESP2, false},
+		{[]string{"3"}, RESP3, false},
+		{[]string{"4"}, 0, true},
+		{[]string{"nope"}, 0, true},
+	}
+
+	for _, c := range cases {
+		var args [][]byte
+		for _, a := range c.args {
+			args = append(args, []byte(a))
+		}
+
+		got, err := HandleHello(args)
+		if c.err {
+			if err == nil {
+				t.Errorf("HandleHello(%v): expected an error", c.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("HandleHello(%v): %v", c.args, err)
+		}
+		if got != c.want {
+			t.Errorf("HandleHello(%v) = %v, want %v", c.args, got, c.want)
+		}
+	}
+}
+
+func TestDowngrade(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"_\r\n", "$-1\r\n"},
+		{"#t\r\n", ":1\r\n"},
+		{"#f\r\n", ":0\r\n"},
+		{",3.14\r\n", "$4\r\n3.14\r\n"},
+		{"=15\r\ntxt:Some string\r\n", "$11\r\nSome string\r\n"},
+		{"!21\r\nSYNTAX invalid syntax\r\n", "-SYNTAX invalid syntax\r\n"},
+		{"%1\r\n$3\r\nfoo\r\n:1\r\n", "*2\r\n$3\r\nfoo\r\n:1\r\n"},
+		{"~1\r\n$3\r\nfoo\r\n", "*1\r\n$3\r\nfoo\r\n"},
+	}
+
+	for _, c := range cases {
+		r := mustParse(t, c.in)
+		r.Downgrade()
+
+		got, err := r.Bytes()
+		if err != nil {
+			t.Fatalf("Bytes() after Downgrade(%q): %v", c.in, err)
+		}
+		if string(got) != c.want {
+			t.Errorf("Downgrade(%q) produced %q, want %q", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+// Copyright 2014 Wandoujia Inc. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package parser
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// RespUnmarshaler is implemented by types that know how to decode
+// themselves from a parsed RESP reply.
+type RespUnmarshaler interface {
+	UnmarshalRESP(r *Resp) error
+}
+
+// Scan decodes r into dest, so callers like SLOTSNUM/SLOTSCHECK and the
+// INFO-parsing backend health probes can stop hand-rolling raw2Bulk/Btoi
+// slicing. With a single destination, r itself (a bulk string, integer,
+// etc.) is decoded into it. With more than one destination, r must be a
+// MultiResp/array reply with at least len(dest) elements, and each
+// destination receives the corresponding element in order.
+//
+// Supported destination types are *string, *[]byte, *int64, *int,
+// *float64, *bool, *time.Duration, *[]string, *map[string]string, any
+// RespUnmarshaler, and a pointer to a struct with `redis:"..."` tags
+// (decoded as if by ScanMap).
+func (r *Resp) Scan(dest ...interface{}) error {
+	if len(dest) == 0 {
+		return nil
+	}
+
+	if len(dest) == 1 {
+		return decodeValue(r, dest[0])
+	}
+
+	if len(r.Multi) < len(dest) {
+		return errors.Errorf("parser: Scan expects %d values, got %d", len(dest), len(r.Multi))
+	}
+
+	for i, d := range dest {
+		if err := decodeValue(r.Multi[i], d); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+// ScanSlice decodes r, an array/set/push reply, into dest, a pointer to a
+// slice. Each element is decoded the same way Scan would decode it alone.
+func (r *Resp) ScanSlice(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return errors.Errorf("parser: ScanSlice needs a pointer to a slice, got %T", dest)
+	}
+
+	elemType := v.Elem().Type().Elem()
+	out := reflect.MakeSlice(v.Elem().Type(), len(r.Multi), len(r.Multi))
+	for i, sub := range r.Multi {
+		elem := reflect.New(elemType)
+		if err := decodeValue(sub, elem.Interface()); err != nil {
+			return errors.Trace(err)
+		}
+		out.Index(i).Set(elem.Elem())
+	}
+
+	v.Elem().Set(out)
+	return nil
+}
+
+// ScanMap decodes r into dest, a pointer to a map[string]V or a struct
+// with `redis:"field_name"` tags (fields without a tag match on their Go
+// name). r may be a genuine RESP3 MapResp, or a flat array of alternating
+// keys and values shaped like an HGETALL or CONFIG GET reply.
+func (r *Resp) ScanMap(dest interface{}) error {
+	pairs, err := r.pairs()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr {
+		return errors.Errorf("parser: ScanMap needs a pointer, got %T", dest)
+	}
+
+	switch v.Elem().Kind() {
+	case reflect.Map:
+		return scanMapInto(v.Elem(), pairs)
+	case reflect.Struct:
+		return scanStructFields(v.Elem(), pairs)
+	default:
+		return errors.Errorf("parser: ScanMap needs a pointer to a map or struct, got %T", dest)
+	}
+}
+
+// pairs splits r's elements into key/value Resp pairs, accepting both a
+// genuine RESP3 map and a flat array of alternating keys and values.
+func (r *Resp) pairs() ([][2]*Resp, error) {
+	if len(r.Multi)%2 != 0 {
+		return nil, errors.Errorf("parser: %+v has an odd number of elements, not a map", r)
+	}
+
+	pairs := make([][2]*Resp, len(r.Multi)/2)
+	for i := range pairs {
+		pairs[i] = [2]*Resp{r.Multi[2*i], r.Multi[2*i+1]}
+	}
+
+	return pairs, nil
+}
+
+func scanMapInto(v reflect.Value, pairs [][2]*Resp) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return errors.Errorf("parser: ScanMap only supports string-keyed maps, got %s", v.Type())
+	}
+
+	out := reflect.MakeMapWithSize(v.Type(), len(pairs))
+	elemType := v.Type().Elem()
+	for _, pair := range pairs {
+		key, err := scalarBytes(pair[0])
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		elem := reflect.New(elemType)
+		if err := decodeValue(pair[1], elem.Interface()); err != nil {
+			return errors.Trace(err)
+		}
+
+		out.SetMapIndex(reflect.ValueOf(string(key)), elem.Elem())
+	}
+
+	v.Set(out)
+	return nil
+}
+
+func scanStructFields(v reflect.Value, pairs [][2]*Resp) error {
+	t := v.Type()
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("redis")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = i
+	}
+
+	for _, pair := range pairs {
+		key, err := scalarBytes(pair[0])
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		idx, ok := fields[string(key)]
+		if !ok {
+			continue
+		}
+
+		if err := decodeValue(pair[1], v.Field(idx).Addr().Interface()); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+func decodeValue(r *Resp, dest interface{}) error {
+	if u, ok := dest.(RespUnmarshaler); ok {
+		return errors.Trace(u.UnmarshalRESP(r))
+	}
+
+	switch d := dest.(type) {
+	case *string:
+		b, err := scalarBytes(r)
+		if err != nil {
+			return err
+		}
+		*d = string(b)
+	case *[]byte:
+		b, err := scalarBytes(r)
+		if err != nil {
+			return err
+		}
+		*d = b
+	case *int64:
+		n, err := scalarInt(r)
+		if err != nil {
+			return err
+		}
+		*d = n
+	case *int:
+		n, err := scalarInt(r)
+		if err != nil {
+			return err
+		}
+		*d = int(n)
+	case *float64:
+		b, err := scalarBytes(r)
+		if err != nil {
+			return err
+		}
+		f, err := strconv.ParseFloat(string(b), 64)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		*d = f
+	case *bool:
+		b, err := scalarBool(r)
+		if err != nil {
+			return err
+		}
+		*d = b
+	case *time.Duration:
+		n, err := scalarInt(r)
+		if err != nil {
+			return err
+		}
+		*d = time.Duration(n)
+	case *[]string:
+		var out []string
+		if err := r.ScanSlice(&out); err != nil {
+			return errors.Trace(err)
+		}
+		*d = out
+	case *map[string]string:
+		var out map[string]string
+		if err := r.ScanMap(&out); err != nil {
+			return errors.Trace(err)
+		}
+		*d = out
+	default:
+		return errors.Trace(scanStruct(r, dest))
+	}
+
+	return nil
+}
+
+func scanStruct(r *Resp, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("parser: cannot scan %+v into %T", r, dest)
+	}
+
+	pairs, err := r.pairs()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return scanStructFields(v.Elem(), pairs)
+}
+
+// scalarBulk reads a length-prefixed bulk-shaped frame ('$', '=', '!')
+// directly off r.Raw's header, returning nil for a null bulk ("$-1\r\n").
+func scalarBulk(r *Resp) ([]byte, error) {
+	end := bytes.IndexByte(r.Raw, '\n')
+	if end < 1 || r.Raw[end-1] != '\r' {
+		return nil, errors.Errorf("parser: invalid resp %+v", r)
+	}
+
+	size, err := Btoi(r.Raw[1 : end-1])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if size < 0 {
+		return nil, nil
+	}
+
+	return r.Raw[end+1 : end+1+size], nil
+}
+
+func scalarBytes(r *Resp) ([]byte, error) {
+	switch r.Type {
+	case NullResp:
+		return nil, nil
+	case SimpleString, IntegerResp, ErrorResp, BooleanResp, DoubleResp, BigNumberResp:
+		return raw2Bulk(r), nil
+	case BulkResp, BlobErrorResp:
+		return scalarBulk(r)
+	case VerbatimResp:
+		b, err := scalarBulk(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > 4 && b[3] == ':' {
+			b = b[4:]
+		}
+		return b, nil
+	default:
+		return nil, errors.Errorf("parser: cannot scan %+v as a scalar", r)
+	}
+}
+
+func scalarInt(r *Resp) (int64, error) {
+	if r.Type == IntegerResp {
+		return strconv.ParseInt(string(raw2Bulk(r)), 10, 64)
+	}
+
+	b, err := scalarBytes(r)
+	if err != nil {
+		return 0, err
+	}
+	if b == nil {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	return n, errors.Trace(err)
+}
+
+func scalarBool(r *Resp) (bool, error) {
+	if r.Type == BooleanResp {
+		return len(r.Raw) > 1 && r.Raw[1] == 't', nil
+	}
+
+	n, err := scalarInt(r)
+	if err != nil {
+		return false, err
+	}
+
+	return n != 0, nil
+}
+
+// Marshal builds a *Resp representing v, so admin tools can construct
+// well-formed replies without touching raw protocol bytes. v may be nil, a
+// bool, any integer or float kind, a string, []byte, a slice/array, or a
+// map/struct (encoded as a flat array of key/value pairs, the shape of an
+// HGETALL reply; struct fields honor `redis:"field_name"` tags).
+func Marshal(v interface{}) (*Resp, error) {
+	return marshalValue(reflect.ValueOf(v))
+}
+
+func marshalValue(v reflect.Value) (*Resp, error) {
+	if !v.IsValid() {
+		return nullBulkResp(), nil
+	}
+
+	switch val := v.Interface().(type) {
+	case []byte:
+		// a nil []byte is a null reply, matching Writer.WriteBulk(nil).
+		if val == nil {
+			return nullBulkResp(), nil
+		}
+		return bulkResp(val), nil
+	case string:
+		return bulkResp([]byte(val)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nullBulkResp(), nil
+		}
+		return marshalValue(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return integerResp(1), nil
+		}
+		return integerResp(0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return integerResp(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return integerResp(int64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return bulkResp([]byte(strconv.FormatFloat(v.Float(), 'f', -1, 64))), nil
+	case reflect.Slice, reflect.Array:
+		multi := make([]*Resp, v.Len())
+		for i := range multi {
+			sub, err := marshalValue(v.Index(i))
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			multi[i] = sub
+		}
+		return arrayResp(multi), nil
+	case reflect.Map:
+		return marshalMap(v)
+	case reflect.Struct:
+		return marshalStruct(v)
+	default:
+		return nil, errors.Errorf("parser: cannot marshal %s", v.Type())
+	}
+}
+
+func marshalMap(v reflect.Value) (*Resp, error) {
+	keys := v.MapKeys()
+	multi := make([]*Resp, 0, 2*len(keys))
+	for _, key := range keys {
+		k, err := marshalValue(key)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		val, err := marshalValue(v.MapIndex(key))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		multi = append(multi, k, val)
+	}
+
+	return arrayResp(multi), nil
+}
+
+func marshalStruct(v reflect.Value) (*Resp, error) {
+	t := v.Type()
+	var multi []*Resp
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("redis")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		val, err := marshalValue(v.Field(i))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		multi = append(multi, bulkResp([]byte(name)), val)
+	}
+
+	return arrayResp(multi), nil
+}
+
+func nullBulkResp() *Resp {
+	return &Resp{Type: BulkResp, Raw: []byte("$-1\r\n")}
+}
+
+func bulkResp(b []byte) *Resp {
+	return &Resp{Type: BulkResp, Raw: bulkFrom(b)}
+}
+
+func integerResp(n int64) *Resp {
+	raw := append([]byte{':'}, AppendInt(nil, n)...)
+	raw = append(raw, NEW_LINE...)
+	return &Resp{Type: IntegerResp, Raw: raw}
+}
+
+func arrayResp(multi []*Resp) *Resp {
+	raw := append([]byte{'*'}, Itoa(len(multi))...)
+	raw = append(raw, NEW_LINE...)
+	return &Resp{Type: MultiResp, Raw: raw, Multi: multi}
+}
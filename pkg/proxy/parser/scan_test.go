@@ -0,0 +1,146 @@
+// Copyright 2014 Wandoujia Inc. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanSingleAndMulti(t *testing.T) {
+	var s string
+	if err := mustParse(t, "$3\r\nfoo\r\n").Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "foo" {
+		t.Errorf("Scan(*string) = %q, want %q", s, "foo")
+	}
+
+	var name string
+	var age int64
+	r := mustParse(t, "*2\r\n$3\r\nbob\r\n:42\r\n")
+	if err := r.Scan(&name, &age); err != nil {
+		t.Fatal(err)
+	}
+	if name != "bob" || age != 42 {
+		t.Errorf("Scan(*string, *int64) = (%q, %d), want (%q, %d)", name, age, "bob", 42)
+	}
+}
+
+func TestScanSlice(t *testing.T) {
+	r := mustParse(t, "*2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n")
+	var out []string
+	if err := r.ScanSlice(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"foo", "bar"}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("ScanSlice = %v, want %v", out, want)
+	}
+}
+
+func TestScanMapFlatArray(t *testing.T) {
+	r := mustParse(t, "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n")
+
+	var out map[string]string
+	if err := r.ScanMap(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "1", "b": "2"}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("ScanMap(map) = %v, want %v", out, want)
+	}
+}
+
+func TestScanMapStruct(t *testing.T) {
+	r := mustParse(t, "*4\r\n$4\r\nname\r\n$3\r\nbob\r\n$3\r\nage\r\n:42\r\n")
+
+	var out struct {
+		Name string `redis:"name"`
+		Age  int64  `redis:"age"`
+	}
+	if err := r.ScanMap(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "bob" || out.Age != 42 {
+		t.Errorf("ScanMap(struct) = %+v, want {Name:bob Age:42}", out)
+	}
+}
+
+func TestMarshalScalars(t *testing.T) {
+	cases := []struct {
+		in   interface{}
+		want string
+	}{
+		{[]byte(nil), "$-1\r\n"},
+		{[]byte("foo"), "$3\r\nfoo\r\n"},
+		{"bar", "$3\r\nbar\r\n"},
+		{42, ":42\r\n"},
+		{true, ":1\r\n"},
+		{false, ":0\r\n"},
+		{nil, "$-1\r\n"},
+	}
+
+	for _, c := range cases {
+		r, err := Marshal(c.in)
+		if err != nil {
+			t.Fatalf("Marshal(%#v): %v", c.in, err)
+		}
+		got, err := r.Bytes()
+		if err != nil {
+			t.Fatalf("Bytes() after Marshal(%#v): %v", c.in, err)
+		}
+		if string(got) != c.want {
+			t.Errorf("Marshal(%#v) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestMarshalNilByteSliceMatchesWriteBulkNil(t *testing.T) {
+	// Marshal's nil []byte handling must agree with Writer.WriteBulk(nil):
+	// both are a null reply, not an empty bulk string.
+	r, err := Marshal([]byte(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "$-1\r\n" {
+		t.Errorf("Marshal([]byte(nil)) = %q, want the same null reply as Writer.WriteBulk(nil) ($-1\\r\\n)", got)
+	}
+}
+
+func TestMarshalSliceAndStruct(t *testing.T) {
+	r, err := Marshal([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "*2\r\n$1\r\na\r\n$1\r\nb\r\n"
+	if string(got) != want {
+		t.Errorf("Marshal([]string) = %q, want %q", got, want)
+	}
+
+	type info struct {
+		Name string `redis:"name"`
+		Age  int    `redis:"age"`
+	}
+	r, err = Marshal(info{Name: "bob", Age: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = r.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "*4\r\n$4\r\nname\r\n$3\r\nbob\r\n$3\r\nage\r\n:42\r\n"
+	if string(got) != want {
+		t.Errorf("Marshal(struct) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2014 Wandoujia Inc. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/juju/errors"
+)
+
+// Kind distinguishes the wire form a command decoded by ReadNextCommand
+// arrived in.
+type Kind int
+
+const (
+	KindRESP Kind = iota
+	KindInline
+	KindNative
+)
+
+// nativeByte marks a length-prefixed native command frame: one byte of
+// nativeByte, a 4-byte big-endian arg count, then for each arg a 4-byte
+// big-endian length followed by that many bytes of payload.
+const nativeByte = 0
+
+// ReadNextCommand decodes a single complete command out of packet without
+// building a *Resp tree, for use on the hot path of a pipelined connection.
+// argsbuf is a caller-owned, reusable scratch slice; the returned args
+// reuses its backing array and its elements point directly into packet, so
+// a decode that finds a complete command allocates nothing as long as
+// argsbuf has capacity for all of its args; otherwise args grows past
+// argsbuf's backing array as append does.
+//
+// When packet holds a full command, it returns complete=true, the decoded
+// args, the Kind of frame that was read, and leftover holding whatever
+// bytes in packet follow it (ready to feed back into the next call). When
+// packet ends mid-command, it returns complete=false and leftover equal to
+// the original packet, so the caller can append more data from the
+// connection and try again.
+func ReadNextCommand(packet []byte, argsbuf [][]byte) (complete bool, args [][]byte, kind Kind, leftover []byte, err error) {
+	if len(packet) == 0 {
+		return false, argsbuf[:0], KindRESP, packet, nil
+	}
+
+	switch packet[0] {
+	case '*':
+		return readRESPCommand(packet, argsbuf)
+	case nativeByte:
+		return readNativeCommand(packet, argsbuf)
+	default:
+		if !IsLetter(packet[0]) {
+			return false, nil, KindInline, packet, errors.Errorf("redis protocol error, %q", packet[0])
+		}
+		return readInlineCommand(packet, argsbuf)
+	}
+}
+
+func readRESPCommand(packet []byte, argsbuf [][]byte) (bool, [][]byte, Kind, []byte, error) {
+	pos := bytes.IndexByte(packet, '\n')
+	if pos < 0 {
+		return false, argsbuf[:0], KindRESP, packet, nil
+	}
+	if pos < 1 || packet[pos-1] != '\r' {
+		return false, nil, KindRESP, packet, errors.Errorf("redis protocol error, invalid multibulk header %q", packet[:pos+1])
+	}
+
+	n, err := Btoi(packet[1 : pos-1])
+	if err != nil {
+		return false, nil, KindRESP, packet, errors.Trace(err)
+	}
+
+	rest := packet[pos+1:]
+	args := argsbuf[:0]
+
+	for i := 0; i < n; i++ {
+		bpos := bytes.IndexByte(rest, '\n')
+		if bpos < 0 {
+			return false, argsbuf[:0], KindRESP, packet, nil
+		}
+		if bpos < 1 || rest[bpos-1] != '\r' || rest[0] != '$' {
+			return false, nil, KindRESP, packet, errors.Errorf("redis protocol error, invalid bulk header %q", rest[:bpos+1])
+		}
+
+		size, err := Btoi(rest[1 : bpos-1])
+		if err != nil {
+			return false, nil, KindRESP, packet, errors.Trace(err)
+		}
+		if size < 0 {
+			return false, nil, KindRESP, packet, errors.Errorf("redis protocol error, invalid bulk length %q", rest[:bpos+1])
+		}
+
+		need := bpos + 1 + size + 2
+		if len(rest) < need {
+			return false, argsbuf[:0], KindRESP, packet, nil
+		}
+
+		args = append(args, rest[bpos+1:bpos+1+size])
+		rest = rest[need:]
+	}
+
+	return true, args, KindRESP, rest, nil
+}
+
+func readInlineCommand(packet []byte, argsbuf [][]byte) (bool, [][]byte, Kind, []byte, error) {
+	pos := bytes.IndexByte(packet, '\n')
+	if pos < 0 {
+		return false, argsbuf[:0], KindInline, packet, nil
+	}
+
+	end := pos
+	if end > 0 && packet[end-1] == '\r' {
+		end--
+	}
+
+	args := argsbuf[:0]
+	line := packet[:end]
+	for len(line) > 0 {
+		for len(line) > 0 && line[0] == ' ' {
+			line = line[1:]
+		}
+		if len(line) == 0 {
+			break
+		}
+		if i := bytes.IndexByte(line, ' '); i >= 0 {
+			args = append(args, line[:i])
+			line = line[i+1:]
+		} else {
+			args = append(args, line)
+			break
+		}
+	}
+
+	return true, args, KindInline, packet[pos+1:], nil
+}
+
+func readNativeCommand(packet []byte, argsbuf [][]byte) (bool, [][]byte, Kind, []byte, error) {
+	const headerLen = 1 + 4
+	if len(packet) < headerLen {
+		return false, argsbuf[:0], KindNative, packet, nil
+	}
+
+	n := int(binary.BigEndian.Uint32(packet[1:headerLen]))
+	rest := packet[headerLen:]
+	args := argsbuf[:0]
+
+	for i := 0; i < n; i++ {
+		if len(rest) < 4 {
+			return false, argsbuf[:0], KindNative, packet, nil
+		}
+
+		size := int(binary.BigEndian.Uint32(rest[:4]))
+		if len(rest) < 4+size {
+			return false, argsbuf[:0], KindNative, packet, nil
+		}
+
+		args = append(args, rest[4:4+size])
+		rest = rest[4+size:]
+	}
+
+	return true, args, KindNative, rest, nil
+}
+
+// AppendCommand appends a RESP multibulk-encoded command built from args to
+// dst and returns the extended slice, growing dst only as needed. It is the
+// write-side companion to ReadNextCommand, for building backend-bound
+// frames into a caller-owned buffer without per-command allocations.
+func AppendCommand(dst []byte, args ...[]byte) []byte {
+	dst = append(dst, '*')
+	dst = append(dst, Itoa(len(args))...)
+	dst = append(dst, NEW_LINE...)
+
+	for _, arg := range args {
+		dst = append(dst, '$')
+		dst = append(dst, Itoa(len(arg))...)
+		dst = append(dst, NEW_LINE...)
+		dst = append(dst, arg...)
+		dst = append(dst, NEW_LINE...)
+	}
+
+	return dst
+}
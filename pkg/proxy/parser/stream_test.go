@@ -0,0 +1,96 @@
+// Copyright 2014 Wandoujia Inc. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadNextCommandRESP(t *testing.T) {
+	packet := AppendCommand(nil, []byte("SET"), []byte("foo"), []byte("bar"))
+	packet = append(packet, "leftover"...)
+
+	complete, args, kind, leftover, err := ReadNextCommand(packet, nil)
+	if err != nil {
+		t.Fatalf("ReadNextCommand: %v", err)
+	}
+	if !complete {
+		t.Fatalf("ReadNextCommand: expected a complete command")
+	}
+	if kind != KindRESP {
+		t.Errorf("kind = %v, want KindRESP", kind)
+	}
+	if len(args) != 3 || string(args[0]) != "SET" || string(args[1]) != "foo" || string(args[2]) != "bar" {
+		t.Errorf("args = %q", args)
+	}
+	if string(leftover) != "leftover" {
+		t.Errorf("leftover = %q, want %q", leftover, "leftover")
+	}
+}
+
+func TestReadNextCommandIncomplete(t *testing.T) {
+	full := AppendCommand(nil, []byte("GET"), []byte("foo"))
+	for _, n := range []int{0, 1, len(full) - 1} {
+		complete, _, _, leftover, err := ReadNextCommand(full[:n], nil)
+		if err != nil {
+			t.Fatalf("ReadNextCommand(%d bytes): %v", n, err)
+		}
+		if complete {
+			t.Errorf("ReadNextCommand(%d bytes): expected incomplete", n)
+		}
+		if !bytes.Equal(leftover, full[:n]) {
+			t.Errorf("ReadNextCommand(%d bytes): leftover = %q, want original packet back", n, leftover)
+		}
+	}
+}
+
+func TestReadNextCommandRejectsNegativeBulkLength(t *testing.T) {
+	// A multibulk command with a $-1 bulk header used to panic with a
+	// slice-bounds-out-of-range error instead of returning a protocol
+	// error.
+	packet := []byte("*1\r\n$-1\r\n")
+
+	complete, _, _, _, err := ReadNextCommand(packet, nil)
+	if err == nil {
+		t.Fatalf("ReadNextCommand(%q): expected a protocol error, got complete=%v", packet, complete)
+	}
+}
+
+func TestReadNextCommandInline(t *testing.T) {
+	complete, args, kind, leftover, err := ReadNextCommand([]byte("PING\r\nrest"), nil)
+	if err != nil {
+		t.Fatalf("ReadNextCommand: %v", err)
+	}
+	if !complete || kind != KindInline {
+		t.Fatalf("ReadNextCommand: complete=%v kind=%v", complete, kind)
+	}
+	if len(args) != 1 || string(args[0]) != "PING" {
+		t.Errorf("args = %q", args)
+	}
+	if string(leftover) != "rest" {
+		t.Errorf("leftover = %q, want %q", leftover, "rest")
+	}
+}
+
+func TestAppendCommand(t *testing.T) {
+	got := AppendCommand(nil, []byte("SET"), []byte("foo"), []byte("bar"))
+	want := "*3\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$3\r\nbar\r\n"
+	if string(got) != want {
+		t.Errorf("AppendCommand = %q, want %q", got, want)
+	}
+}
+
+func BenchmarkReadNextCommand(b *testing.B) {
+	packet := AppendCommand(nil, []byte("SET"), []byte("foo"), []byte("bar"))
+	argsbuf := make([][]byte, 0, 3)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, _, err := ReadNextCommand(packet, argsbuf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
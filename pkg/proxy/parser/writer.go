@@ -0,0 +1,182 @@
+// Copyright 2014 Wandoujia Inc. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package parser
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// scratchPool holds reusable buffers for encoding RESP lengths and
+// integers, so Writer's hot path doesn't allocate one per call.
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 32)
+		return &buf
+	},
+}
+
+// Writer streams RESP frames directly to an underlying io.Writer. It is
+// the write-side counterpart to Parse: where Resp.Bytes() has to build a
+// fresh []byte for every response (and every nested element of one),
+// Writer and Resp.WriteTo write straight through a buffered writer.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter wraps w for RESP encoding, reusing w directly if it is already
+// a *bufio.Writer.
+func NewWriter(w io.Writer) *Writer {
+	if bw, ok := w.(*bufio.Writer); ok {
+		return &Writer{w: bw}
+	}
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func (w *Writer) write(b []byte) (int64, error) {
+	n, err := w.w.Write(b)
+	return int64(n), errors.Trace(err)
+}
+
+func (w *Writer) writeLine(prefix byte, body []byte) error {
+	if err := w.w.WriteByte(prefix); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := w.w.Write(body); err != nil {
+		return errors.Trace(err)
+	}
+	_, err := w.w.Write(NEW_LINE)
+	return errors.Trace(err)
+}
+
+func (w *Writer) writeIntLine(prefix byte, n int64) error {
+	bp := scratchPool.Get().(*[]byte)
+	*bp = AppendInt((*bp)[:0], n)
+	err := w.writeLine(prefix, *bp)
+	scratchPool.Put(bp)
+	return err
+}
+
+// WriteArray writes a "*n\r\n" array header for n elements, each of which
+// must be written by a following call.
+func (w *Writer) WriteArray(n int) error {
+	return w.writeIntLine('*', int64(n))
+}
+
+// WriteBulk writes b as a RESP bulk string, or a null bulk string if b is
+// nil.
+func (w *Writer) WriteBulk(b []byte) error {
+	if b == nil {
+		return w.WriteNull()
+	}
+	if err := w.writeIntLine('$', int64(len(b))); err != nil {
+		return err
+	}
+	_, err := w.write(b)
+	if err != nil {
+		return err
+	}
+	_, err = w.write(NEW_LINE)
+	return err
+}
+
+// WriteBulkString writes s as a RESP bulk string.
+func (w *Writer) WriteBulkString(s string) error {
+	return w.WriteBulk([]byte(s))
+}
+
+// WriteInt writes n as a RESP integer reply.
+func (w *Writer) WriteInt(n int64) error {
+	return w.writeIntLine(':', n)
+}
+
+// WriteSimpleString writes s as a RESP simple string (+s\r\n). s must not
+// contain \r or \n.
+func (w *Writer) WriteSimpleString(s string) error {
+	return w.writeLine('+', []byte(s))
+}
+
+// WriteError writes s as a RESP error reply (-s\r\n). s must not contain
+// \r or \n.
+func (w *Writer) WriteError(s string) error {
+	return w.writeLine('-', []byte(s))
+}
+
+// WriteNull writes a RESP2 null bulk string ($-1\r\n).
+func (w *Writer) WriteNull() error {
+	if _, err := w.write([]byte("$-1")); err != nil {
+		return err
+	}
+	_, err := w.write(NEW_LINE)
+	return err
+}
+
+// WriteArgs writes args as a RESP array of bulk strings, the shape of a
+// command sent to a backend.
+func (w *Writer) WriteArgs(args [][]byte) error {
+	if err := w.WriteArray(len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if err := w.WriteBulk(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush flushes any buffered data to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	return errors.Trace(w.w.Flush())
+}
+
+// WriteTo streams r to w without building an intermediate []byte, the
+// streaming counterpart to Bytes().
+func (r *Resp) WriteTo(w *Writer) (int64, error) {
+	var n int64
+
+	if r.Attr != nil {
+		m, err := r.Attr.WriteTo(w)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+
+	switch r.Type {
+	case NoKey:
+		m, err := w.write(raw2Bulk(r))
+		n += m
+		if err != nil {
+			return n, err
+		}
+		m, err = w.write(NEW_LINE)
+		n += m
+		return n, err
+	case SimpleString, ErrorResp, IntegerResp, BulkResp, VerbatimResp, BlobErrorResp,
+		NullResp, BooleanResp, DoubleResp, BigNumberResp:
+		m, err := w.write(r.Raw)
+		n += m
+		return n, err
+	case MultiResp, MapResp, SetResp, AttributeResp, PushResp:
+		m, err := w.write(r.Raw)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		for _, sub := range r.Multi {
+			m, err := sub.WriteTo(w)
+			n += m
+			if err != nil {
+				return n, err
+			}
+		}
+		return n, nil
+	}
+
+	return n, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2014 Wandoujia Inc. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriterBasicTypes(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	if err := w.WriteBulk([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteBulk(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteBulkString("bar"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteInt(42); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSimpleString("OK"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteError("ERR oops"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteNull(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteArgs([][]byte{[]byte("SET"), []byte("foo"), []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "$3\r\nfoo\r\n" +
+		"$-1\r\n" +
+		"$3\r\nbar\r\n" +
+		":42\r\n" +
+		"+OK\r\n" +
+		"-ERR oops\r\n" +
+		"$-1\r\n" +
+		"*3\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$3\r\nbar\r\n"
+	if buf.String() != want {
+		t.Errorf("Writer output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteBulkNilMatchesWriteNull(t *testing.T) {
+	var bulkBuf, nullBuf bytes.Buffer
+
+	bulkWriter := NewWriter(&bulkBuf)
+	if err := bulkWriter.WriteBulk(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := bulkWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	nullWriter := NewWriter(&nullBuf)
+	if err := nullWriter.WriteNull(); err != nil {
+		t.Fatal(err)
+	}
+	if err := nullWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if bulkBuf.String() != nullBuf.String() {
+		t.Errorf("WriteBulk(nil) = %q, WriteNull() = %q, want equal", bulkBuf.String(), nullBuf.String())
+	}
+}
+
+func TestRespWriteToMirrorsBytes(t *testing.T) {
+	cases := []string{
+		"+OK\r\n",
+		"-ERR oops\r\n",
+		":42\r\n",
+		"$3\r\nfoo\r\n",
+		"*2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n",
+		"_\r\n",
+		"#t\r\n",
+		",3.14\r\n",
+		"%1\r\n$3\r\nfoo\r\n:1\r\n",
+		"|1\r\n$8\r\nttl-info\r\n:100\r\n$3\r\nfoo\r\n",
+	}
+
+	for _, c := range cases {
+		r := mustParse(t, c)
+
+		wantBytes, err := r.Bytes()
+		if err != nil {
+			t.Fatalf("Bytes(%q): %v", c, err)
+		}
+
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if _, err := r.WriteTo(w); err != nil {
+			t.Fatalf("WriteTo(%q): %v", c, err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		if buf.String() != string(wantBytes) {
+			t.Errorf("WriteTo(%q) = %q, want %q (same as Bytes())", c, buf.String(), wantBytes)
+		}
+	}
+}